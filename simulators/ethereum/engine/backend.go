@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/hive/hivesim"
+)
+
+// Backend is the source of the Eth/Engine/RPC clients a TestEnv drives.
+// The default implementation, liveBackend, talks to a real hivesim.Client
+// container over HTTP. simulatedBackend instead runs an in-process
+// dev-mode geth via ethclient/simulated, so tests that only need Eth
+// (transaction construction, helper unit tests) can run in milliseconds
+// without spawning any containers; it does not implement Engine() or
+// RPC() (both panic), so it is not a general offline stand-in for Engine API tests. Test
+// bodies written against TestEnv do not need to know which one they got:
+// only RunTest/RunSimulatedTest (and CheckEthEngineLive, which only applies
+// to the live backend) care.
+type Backend interface {
+	Eth() *ethclient.Client
+	Engine() *EngineClient
+	RPC() *rpc.Client
+	Close()
+}
+
+// liveBackend is the Backend implementation backed by a real
+// hivesim.Client execution client container, dialed over HTTP/Engine-API.
+// This is what every test used prior to the introduction of Backend, and
+// remains the default for RunTest.
+type liveBackend struct {
+	client *hivesim.Client
+	rpc    *rpc.Client
+	eth    *ethclient.Client
+	engine *EngineClient
+}
+
+// newLiveBackend performs the HTTP dial and engine client construction
+// that used to live directly in RunTest, now isolated behind Backend so
+// RunTest and RunSimulatedTest can share the rest of the setup/teardown
+// logic.
+func newLiveBackend(t *hivesim.T, c *hivesim.Client, ttd *big.Int) (*liveBackend, error) {
+	if err := CheckEthEngineLive(c); err != nil {
+		return nil, fmt.Errorf("ports were never open for client: %v", err)
+	}
+	httpClient := &http.Client{
+		Transport: &loggingRoundTrip{
+			t:     t,
+			hc:    c,
+			inner: http.DefaultTransport,
+		},
+	}
+	rpcClient, err := rpc.DialHTTPWithClient(fmt.Sprintf("http://%v:%v/", c.IP, EthPortHTTP), httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("unable to dial eth client: %v", err)
+	}
+	engine := NewEngineClient(t, c, ttd)
+	return &liveBackend{
+		client: c,
+		rpc:    rpcClient,
+		eth:    ethclient.NewClient(rpcClient),
+		engine: engine,
+	}, nil
+}
+
+func (b *liveBackend) Eth() *ethclient.Client { return b.eth }
+func (b *liveBackend) Engine() *EngineClient  { return b.engine }
+func (b *liveBackend) RPC() *rpc.Client       { return b.rpc }
+func (b *liveBackend) Close() {
+	b.engine.Close()
+	b.rpc.Close()
+}
+
+// simulatedBackend runs an in-process dev-mode geth via
+// ethclient/simulated.Backend. It gives pure transaction-construction and
+// other Eth-only unit tests a millisecond-scale path that never touches
+// Docker, exposing the same Eth() surface a live backend does.
+//
+// RPC() and Engine() are deliberately unimplemented, not merely pending:
+// simulated.Backend doesn't expose the raw *rpc.Client its ethclient.Client
+// dials over, nor the in-process catalyst ConsensusAPI used to serve
+// engine_* calls, and bridging the latter would require a constructor that
+// builds an EngineClient from an *rpc.Client directly (today NewEngineClient
+// always dials a hivesim.Client's Engine port over HTTP). Both panic with an
+// explanatory message rather than returning nil, so a test that reaches for
+// either fails loudly instead of hitting a nil-pointer dereference
+// somewhere downstream. Anything needing raw RPC or the Engine API -- which
+// includes all CL-mock-driven payload/forkchoice tests -- still requires a
+// liveBackend; this type is not an offline substitute for those.
+type simulatedBackend struct {
+	sim *simulated.Backend
+	eth *ethclient.Client
+}
+
+// newSimulatedBackend starts an in-process dev-mode geth node.
+func newSimulatedBackend() (*simulatedBackend, error) {
+	sim := simulated.NewBackend(nil)
+	client := sim.Client()
+	return &simulatedBackend{
+		sim: sim,
+		eth: client,
+	}, nil
+}
+
+func (b *simulatedBackend) Eth() *ethclient.Client { return b.eth }
+func (b *simulatedBackend) RPC() *rpc.Client {
+	panic("simulatedBackend: raw RPC access is not implemented; see the simulatedBackend doc comment")
+}
+func (b *simulatedBackend) Engine() *EngineClient {
+	panic("simulatedBackend: Engine API bridging is not implemented; see the simulatedBackend doc comment")
+}
+func (b *simulatedBackend) Close() { b.sim.Close() }
+
+// RunSimulatedTest runs fn against an in-process dev-mode geth instead of a
+// container, for tests that only need Eth (transaction construction,
+// helper unit tests) and don't drive the CL mock/Engine API or raw RPC. It
+// is not a drop-in replacement for RunTest and not a general offline mode
+// for Engine API tests: env.CLMock is nil, and env.Engine()/env.RPC.
+// CallContext panic/nil-deref, so fn must not touch either.
+func RunSimulatedTest(t *hivesim.T, testName string, fn func(*TestEnv)) {
+	backend, err := newSimulatedBackend()
+	if err != nil {
+		t.Fatalf("FAIL (%s): unable to start simulated backend: %v", testName, err)
+	}
+	defer backend.Close()
+
+	env := &TestEnv{
+		T:        t,
+		TestName: testName,
+		Eth:      backend.Eth(),
+		backend:  backend,
+	}
+	env.TestEth = NewTestEthClient(env, env.Eth)
+
+	defer func() {
+		if env.lastCtx != nil {
+			env.lastCancel()
+		}
+	}()
+
+	fn(env)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/hive/hivesim"
+)
+
+// jwtSecretMountPath is the standard hive mount path clients read their
+// Engine API JWT secret from.
+const jwtSecretMountPath = "/jwt.secret"
+
+// jwtAllowedDrift is the maximum "iat" skew, in either direction, that a
+// conforming Engine API implementation must accept. It mirrors the window
+// used by go-ethereum's and Prysm's JWT verifiers (EIP-3085's `jwtSecret`
+// handshake).
+const jwtAllowedDrift = 60 * time.Second
+
+// jwtAuthRoundTrip signs a fresh token for every request and attaches it as
+// an `Authorization: Bearer` header, so each call reflects the current
+// iatOffset rather than a token minted once at client creation time.
+type jwtAuthRoundTrip struct {
+	inner     http.RoundTripper
+	secret    []byte
+	iatOffset time.Duration
+	alg       string
+	malformed bool
+}
+
+func (rt *jwtAuthRoundTrip) RoundTrip(req *http.Request) (*http.Response, error) {
+	var token string
+	if rt.malformed {
+		// Deliberately not a parseable JWT at all (wrong number of
+		// segments), independent of the alg/secret/drift dimensions
+		// above -- this exercises the server's token-parsing path
+		// rather than its signature/claims verification.
+		token = "not-a.valid-jwt"
+	} else {
+		var err error
+		token, err = signJWT(rt.secret, rt.alg, time.Now().Add(rt.iatOffset))
+		if err != nil {
+			return nil, fmt.Errorf("unable to sign jwt: %v", err)
+		}
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return rt.inner.RoundTrip(req)
+}
+
+// signJWT builds a JWT with the given alg header and a single "iat" claim,
+// the only claim the Engine API authentication spec requires. For alg
+// "none" the signature segment is left empty. For any other alg value
+// (used to probe algorithm-confusion handling) the signature is HMAC-SHA256
+// over the secret, the same way a naive verifier keyed only off the
+// secret might accept, i.e. it does not attempt to actually implement the
+// named algorithm.
+func signJWT(secret []byte, alg string, iat time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{"iat": iat.Unix()})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	if alg == "none" {
+		// The classic alg=none attack: no signature segment at all.
+		return unsigned + ".", nil
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	sig := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	return unsigned + "." + sig, nil
+}
+
+// NewAuthClient dials the given client's Engine API port using a JWT
+// bearer token signed with secret and an "iat" claim offset from "now" by
+// iatOffset, using the given alg header. Passing an iatOffset outside the
+// server's allowed drift window, a secret that does not match what the
+// client was launched with, or an alg other than "HS256" should result in
+// every call being rejected. If malformed is true, the token is replaced
+// with a syntactically invalid one and secret/iatOffset/alg are ignored.
+func NewAuthClient(t *hivesim.T, c *hivesim.Client, secret []byte, iatOffset time.Duration, alg string, malformed bool) *rpc.Client {
+	httpClient := &http.Client{
+		Transport: &jwtAuthRoundTrip{
+			inner:     http.DefaultTransport,
+			secret:    secret,
+			iatOffset: iatOffset,
+			alg:       alg,
+			malformed: malformed,
+		},
+	}
+	endpoint := fmt.Sprintf("http://%v:%v/", c.IP, EnginePortHTTP)
+	rpcClient, err := rpc.DialHTTPWithClient(endpoint, httpClient)
+	if err != nil {
+		t.Fatalf("FAIL: unable to dial engine API for %s: %v", c.Type, err)
+	}
+	return rpcClient
+}
+
+// jwtAuthTest is a single row of the JWT conformance table: the secret
+// actually loaded by the client (via ClientFiles), the secret used to sign
+// the probing token, the iat skew to apply, the alg header to emit, and
+// whether the call is expected to succeed.
+type jwtAuthTest struct {
+	Name           string
+	ClientSecret   []byte
+	TokenSecret    []byte
+	IatOffset      time.Duration
+	Alg            string
+	MalformedToken bool
+	WantAccept     bool
+}
+
+var defaultJWTSecret = hexutil.MustDecode("0x7365637265747365637265747365637265747365637265747365637265747365")
+
+// jwtAuthTests is the table-driven set of subtests for the JWT
+// authentication conformance suite: correct secret/zero drift must be
+// accepted, and every other row -- wrong secret, excessive drift in either
+// direction, alg "none", a malformed token, or no Authorization header at
+// all -- must be rejected.
+var jwtAuthTests = []jwtAuthTest{
+	{
+		Name:         "CorrectSecretZeroDrift",
+		ClientSecret: defaultJWTSecret,
+		TokenSecret:  defaultJWTSecret,
+		IatOffset:    0,
+		Alg:          "HS256",
+		WantAccept:   true,
+	},
+	{
+		Name:         "DriftExceedsWindowFuture",
+		ClientSecret: defaultJWTSecret,
+		TokenSecret:  defaultJWTSecret,
+		IatOffset:    jwtAllowedDrift + 10*time.Second,
+		Alg:          "HS256",
+		WantAccept:   false,
+	},
+	{
+		Name:         "DriftExceedsWindowPast",
+		ClientSecret: defaultJWTSecret,
+		TokenSecret:  defaultJWTSecret,
+		IatOffset:    -(jwtAllowedDrift + 10*time.Second),
+		Alg:          "HS256",
+		WantAccept:   false,
+	},
+	{
+		Name:         "WrongSecret",
+		ClientSecret: defaultJWTSecret,
+		TokenSecret:  hexutil.MustDecode("0x00112233445566778899aabbccddeeff00112233445566778899aabbccddee"),
+		IatOffset:    0,
+		Alg:          "HS256",
+		WantAccept:   false,
+	},
+	{
+		Name:         "NoneAlgorithm",
+		ClientSecret: defaultJWTSecret,
+		TokenSecret:  defaultJWTSecret,
+		IatOffset:    0,
+		Alg:          "none",
+		WantAccept:   false,
+	},
+	{
+		Name:           "MalformedToken",
+		ClientSecret:   defaultJWTSecret,
+		MalformedToken: true,
+		WantAccept:     false,
+	},
+	{
+		Name:         "MissingHeader",
+		ClientSecret: defaultJWTSecret,
+		WantAccept:   false,
+	},
+}
+
+// jwtSecretFile writes secret, hex-encoded, to a temporary file and returns
+// its path so it can be handed to hivesim.Params as a ClientFiles entry.
+func jwtSecretFile(secret []byte) (string, error) {
+	f, err := os.CreateTemp("", "hive-engine-jwt-secret-*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(hex.EncodeToString(secret)); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// JWTAuthTestSpecs builds the hivesim test specs for the JWT conformance
+// suite. Each client under test is launched once per row with
+// ClientSecret mounted via ClientFiles at the standard hive JWT path, then
+// probed with a token built from TokenSecret/IatOffset/Alg.
+func JWTAuthTestSpecs() []hivesim.TestSpec {
+	var specs []hivesim.TestSpec
+	for _, tc := range jwtAuthTests {
+		tc := tc
+		files, err := jwtAuthClientFiles(tc.ClientSecret)
+		if err != nil {
+			panic(err)
+		}
+		specs = append(specs, hivesim.TestSpec{
+			Name:  fmt.Sprintf("engine-auth/%s", tc.Name),
+			About: "Tests the Authorization: Bearer handshake on the Engine API port",
+			Files: files,
+			Run: func(t *hivesim.T, c *hivesim.Client) {
+				runJWTAuthTest(t, c, tc)
+			},
+		})
+	}
+	return specs
+}
+
+// jwtAuthClientFiles returns the ClientFiles entry that mounts secret at
+// the standard hive JWT path, so every client type loads it the same way
+// it would load a real secret in production.
+func jwtAuthClientFiles(secret []byte) (hivesim.Params, error) {
+	path, err := jwtSecretFile(secret)
+	if err != nil {
+		return nil, fmt.Errorf("unable to write jwt secret file: %v", err)
+	}
+	return hivesim.Params{jwtSecretMountPath: path}, nil
+}
+
+func runJWTAuthTest(t *hivesim.T, c *hivesim.Client, tc jwtAuthTest) {
+	var rpcClient *rpc.Client
+	if tc.Name == "MissingHeader" {
+		var err error
+		rpcClient, err = rpc.Dial(fmt.Sprintf("http://%v:%v/", c.IP, EnginePortHTTP))
+		if err != nil {
+			t.Fatalf("FAIL (%s): unable to dial engine API: %v", tc.Name, err)
+		}
+	} else {
+		rpcClient = NewAuthClient(t, c, tc.TokenSecret, tc.IatOffset, tc.Alg, tc.MalformedToken)
+	}
+	defer rpcClient.Close()
+
+	var result interface{}
+	err := rpcClient.Call(&result, "engine_exchangeTransitionConfigurationV1", map[string]string{
+		"terminalTotalDifficulty": "0x0",
+		"terminalBlockHash":       "0x0000000000000000000000000000000000000000000000000000000000000000",
+		"terminalBlockNumber":     "0x0",
+	})
+	accepted := err == nil
+	if accepted != tc.WantAccept {
+		t.Fatalf("FAIL (%s): call accepted=%v, want accepted=%v (err=%v)", tc.Name, accepted, tc.WantAccept, err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ethereum/hive/hivesim"
+)
+
+// ForEachEngine runs fn against every registered execution client's
+// TestEngineClient, in registration order (primary client first). Use this
+// to apply the same engine API call or assertion to all clients driven by
+// the CL mock in a multi-client test.
+func (t *TestEnv) ForEachEngine(fn func(idx int, te *TestEngineClient)) {
+	for idx, te := range t.TestEngines {
+		fn(idx, te)
+	}
+}
+
+// ExpectAllPayloadStatus asserts that get(te) returns wantStatus for every
+// registered execution client, failing the test with the offending
+// client's index otherwise. get is typically a closure over the
+// engine_newPayload/forkchoiceUpdated response being checked, e.g.:
+//
+//	env.ExpectAllPayloadStatus("VALID", func(te *TestEngineClient) string {
+//	    return te.TestEngineNewPayloadV2(payload).Status
+//	})
+func (t *TestEnv) ExpectAllPayloadStatus(wantStatus string, get func(te *TestEngineClient) string) {
+	for idx, te := range t.TestEngines {
+		if got := get(te); got != wantStatus {
+			t.Fatalf("FAIL (%s): client %d (%s) returned status=%s, want=%s", t.TestName, idx, t.Clients[idx].Type, got, wantStatus)
+		}
+	}
+}
+
+// ExpectDivergence asserts that get(te), evaluated for every registered
+// execution client, does NOT produce the same result across all of them --
+// i.e. it fails the test if every client agrees. This is the inverse of
+// ExpectAllPayloadStatus and is used to confirm that a deliberately
+// ambiguous payload/fork-choice sequence is actually exercising a
+// difference in client behavior rather than being a no-op test.
+func (t *TestEnv) ExpectDivergence(get func(te *TestEngineClient) string) {
+	if len(t.TestEngines) < 2 {
+		t.Fatalf("FAIL (%s): ExpectDivergence requires at least 2 registered clients, have %d", t.TestName, len(t.TestEngines))
+	}
+	results := make([]string, len(t.TestEngines))
+	for idx, te := range t.TestEngines {
+		results[idx] = get(te)
+	}
+	first := results[0]
+	for _, r := range results[1:] {
+		if r != first {
+			return
+		}
+	}
+	t.Fatalf("FAIL (%s): expected clients to diverge, but all returned %q: %s", t.TestName, first, summarizeResults(t.Clients, results))
+}
+
+func summarizeResults(clients []*hivesim.Client, results []string) string {
+	s := ""
+	for i, r := range results {
+		if i > 0 {
+			s += ", "
+		}
+		s += fmt.Sprintf("client %d=%s", i, r)
+	}
+	return s
+}
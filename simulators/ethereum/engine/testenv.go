@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"math/big"
 	"net"
-	"net/http"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -35,15 +34,25 @@ const (
 type TestEnv struct {
 	*hivesim.T
 	TestName string
-	Client   *hivesim.Client
 
-	// RPC Clients
+	// Execution clients driven by the CL mock during this test. Index 0
+	// is the primary client returned by RunTest; additional clients
+	// registered with AddClient are appended so a single test can drive
+	// more than one execution client off the same payload sequence.
+	Clients []*hivesim.Client
+	Engines []*EngineClient
+
+	// RPC Clients for the primary client (Clients[0]/Engines[0]).
 	RPC        *rpc.Client
 	Eth        *ethclient.Client
-	Engine     *EngineClient
 	TestEngine *TestEngineClient
 	TestEth    *TestEthClient
 
+	// TestEngines parallels Engines, one TestEngineClient per registered
+	// execution client, for assertions that need to inspect or compare
+	// responses across all of them.
+	TestEngines []*TestEngineClient
+
 	// Consensus Layer Mocker Instance
 	CLMock *CLMocker
 
@@ -57,6 +66,9 @@ type TestEnv struct {
 	// This tracks the account nonce of the vault account.
 	nonce uint64
 
+	// Queued withdrawals and bookkeeping for Shanghai/Capella tests.
+	withdrawals WithdrawalsState
+
 	// Sets the type of transactions to use during the test
 	TestTransactionType TestTransactionType
 
@@ -66,6 +78,14 @@ type TestEnv struct {
 	lastCtx    context.Context
 	lastCancel context.CancelFunc
 	syncCancel context.CancelFunc
+
+	// backend is the source of Engines[0]/RPC/Eth. It is only
+	// consulted as a fallback by Engine() when no client has been
+	// registered (e.g. under RunSimulatedTest), so a test that reaches
+	// for the Engine API on a backend that doesn't support it gets
+	// backend's own explanatory panic instead of a generic index-out-of-
+	// range one.
+	backend Backend
 }
 
 func RunTest(testName string, ttd *big.Int, slotsToSafe *big.Int, slotsToFinalized *big.Int, timeout time.Duration, t *hivesim.T, c *hivesim.Client, fn func(*TestEnv), cParams hivesim.Params, cFiles hivesim.Params, testTransactionType TestTransactionType) {
@@ -79,34 +99,29 @@ func RunTest(testName string, ttd *big.Int, slotsToSafe *big.Int, slotsToFinaliz
 	// Add main client to CLMocker
 	clMocker.AddEngineClient(t, c, ttd)
 
-	// This sets up debug logging of the requests and responses.
-	client := &http.Client{
-		Transport: &loggingRoundTrip{
-			t:     t,
-			hc:    c,
-			inner: http.DefaultTransport,
-		},
+	// Dial the main client's Eth/Engine ports through the live Backend,
+	// which waits for both ports to open before dialing.
+	backend, err := newLiveBackend(t, c, ttd)
+	if err != nil {
+		t.Fatalf("FAIL (%s): unable to set up client backend: %v", testName, err)
 	}
+	defer backend.Close()
 
-	// Create Engine client from main hivesim.Client to be used by tests
-	ec := NewEngineClient(t, c, ttd)
-	defer ec.Close()
-
-	rpcClient, _ := rpc.DialHTTPWithClient(fmt.Sprintf("http://%v:%v/", c.IP, EthPortHTTP), client)
-	defer rpcClient.Close()
 	env := &TestEnv{
 		T:                   t,
 		TestName:            testName,
-		Client:              c,
-		RPC:                 rpcClient,
-		Eth:                 ethclient.NewClient(rpcClient),
-		Engine:              ec,
+		Clients:             []*hivesim.Client{c},
+		Engines:             []*EngineClient{backend.Engine()},
+		RPC:                 backend.RPC(),
+		Eth:                 backend.Eth(),
 		CLMock:              clMocker,
 		ClientParams:        cParams,
 		ClientFiles:         cFiles,
 		TestTransactionType: testTransactionType,
+		backend:             backend,
 	}
-	env.TestEngine = NewTestEngineClient(env, ec)
+	env.TestEngine = NewTestEngineClient(env, backend.Engine())
+	env.TestEngines = []*TestEngineClient{env.TestEngine}
 	env.TestEth = NewTestEthClient(env, env.Eth)
 
 	// Defer closing the last context
@@ -127,10 +142,8 @@ func RunTest(testName string, ttd *big.Int, slotsToSafe *big.Int, slotsToFinaliz
 		}
 	}()
 
-	// Before running the test, make sure Eth and Engine ports are open for the client
-	if err := CheckEthEngineLive(c); err != nil {
-		t.Fatalf("FAIL (%s): Ports were never open for client: %v", env.TestName, err)
-	}
+	// newLiveBackend already waited for the Eth and Engine ports to open
+	// above, so there's no need to check again here.
 
 	// Setup timeouts
 	env.Timeout = time.After(timeout)
@@ -148,8 +161,26 @@ func RunTest(testName string, ttd *big.Int, slotsToSafe *big.Int, slotsToFinaliz
 	fn(env)
 }
 
+// Client returns the primary execution client for this test, i.e. the one
+// passed to RunTest. Use AddClient to register additional ones.
+func (t *TestEnv) Client() *hivesim.Client {
+	return t.Clients[0]
+}
+
+// Engine returns the engine API client of the primary execution client.
+func (t *TestEnv) Engine() *EngineClient {
+	if len(t.Engines) == 0 {
+		// No client registered -- most likely a RunSimulatedTest env.
+		// Let the backend explain why (e.g. simulatedBackend's Engine API
+		// bridging is not implemented) rather than panicking here with a
+		// generic index-out-of-range.
+		return t.backend.Engine()
+	}
+	return t.Engines[0]
+}
+
 func (t *TestEnv) MainTTD() *big.Int {
-	return t.Engine.TerminalTotalDifficulty
+	return t.Engine().TerminalTotalDifficulty
 }
 
 func (t *TestEnv) StartClient(clientType string, params hivesim.Params, ttd *big.Int) (*hivesim.Client, *EngineClient, error) {
@@ -161,6 +192,26 @@ func (t *TestEnv) StartClient(clientType string, params hivesim.Params, ttd *big
 	return c, ec, nil
 }
 
+// AddClient launches an additional execution client of the given type and
+// registers it with both this TestEnv and the CL mock, so that subsequent
+// produceSingleBlock calls drive it with the same payload sequence as every
+// other registered client. It returns the index into Engines/TestEngines
+// that the new client was assigned, so callers can address it later (e.g.
+// via TestEngines[idx] or ExpectDivergence).
+func (t *TestEnv) AddClient(clientType string, params hivesim.Params) (int, error) {
+	c, ec, err := t.StartClient(clientType, params, t.MainTTD())
+	if err != nil {
+		return -1, fmt.Errorf("unable to start client %s: %v", clientType, err)
+	}
+	t.CLMock.AddEngineClient(t.T, c, t.MainTTD())
+
+	idx := len(t.Clients)
+	t.Clients = append(t.Clients, c)
+	t.Engines = append(t.Engines, ec)
+	t.TestEngines = append(t.TestEngines, NewTestEngineClient(t, ec))
+	return idx, nil
+}
+
 func CheckEthEngineLive(c *hivesim.Client) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
@@ -345,3 +396,32 @@ func (t *TestEnv) Ctx() context.Context {
 	t.lastCtx, t.lastCancel = context.WithTimeout(context.Background(), rpcTimeout)
 	return t.lastCtx
 }
+
+// AdjustNonce reconciles TestEnv's cached vault nonce with the primary
+// client's actual account state. Pass newNonce to set it explicitly, or
+// nil to re-fetch the pending nonce from the client.
+//
+// Tests that force a reorg via engine_forkchoiceUpdated (or, in the
+// future, debug_setHead/snapshot reverts) can leave the vault nonce out of
+// step with what the client will actually accept, since makeNextTransaction
+// increments it optimistically as soon as a transaction is built. Call
+// this with nil after such a reorg, before the next sendNextTransaction,
+// so that call doesn't keep retrying a rejected nonce until the test
+// timeout. There is no
+// automatic hook for this yet: it is on the test author to call it after
+// any forkchoice update that may have rewound headBlockHash below a
+// block a previously-sent vault transaction was included in.
+func (t *TestEnv) AdjustNonce(newNonce *uint64) error {
+	if newNonce != nil {
+		t.nonce = *newNonce
+		t.Logf("INFO (%s): Vault nonce adjusted to %d", t.TestName, t.nonce)
+		return nil
+	}
+	n, err := t.Eth.PendingNonceAt(t.Ctx(), vaultAccountAddr)
+	if err != nil {
+		return fmt.Errorf("unable to recover vault nonce: %v", err)
+	}
+	t.Logf("INFO (%s): Vault nonce re-fetched from client: %d -> %d", t.TestName, t.nonce, n)
+	t.nonce = n
+	return nil
+}
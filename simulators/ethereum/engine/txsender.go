@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// addrLocker serializes access to a single account's nonce the same way
+// go-ethereum's accounts/abi/bind and status-go's addrlock do: callers take
+// the per-address lock for the whole sign->send->receipt cycle so that two
+// goroutines never race to claim the same nonce.
+type addrLocker struct {
+	mu    sync.Mutex
+	locks map[common.Address]*sync.Mutex
+}
+
+func (l *addrLocker) lock(addr common.Address) *sync.Mutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locks == nil {
+		l.locks = make(map[common.Address]*sync.Mutex)
+	}
+	if _, ok := l.locks[addr]; !ok {
+		l.locks[addr] = new(sync.Mutex)
+	}
+	return l.locks[addr]
+}
+
+// txSenderAccount tracks the signing key and cached nonce of a single
+// funded account managed by a TxSender.
+type txSenderAccount struct {
+	key   *ecdsa.PrivateKey
+	addr  common.Address
+	nonce uint64
+}
+
+// TxSender manages a pool of funded accounts and dispatches transactions
+// from them concurrently. Unlike TestEnv.sendNextTransaction, which only
+// ever signs from the single vault account and serializes on TestEnv.nonce,
+// a TxSender can be shared across goroutines and across any number of
+// sender accounts: each Send call signs, sends, and waits for the receipt
+// of exactly one transaction while holding that sender's address lock, so
+// concurrent sends from different accounts never block each other.
+type TxSender struct {
+	env     *TestEnv
+	eth     *ethclient.Client
+	rpc     *rpc.Client
+	locker  addrLocker
+	mu      sync.Mutex
+	senders map[common.Address]*txSenderAccount
+}
+
+// NewTxSender creates a TxSender backed by env's RPC/Eth clients and seeds
+// it with the given funded keys.
+func NewTxSender(env *TestEnv, keys ...*ecdsa.PrivateKey) *TxSender {
+	s := &TxSender{
+		env:     env,
+		eth:     env.Eth,
+		rpc:     env.RPC,
+		senders: make(map[common.Address]*txSenderAccount),
+	}
+	for _, key := range keys {
+		s.AddSender(key)
+	}
+	return s
+}
+
+// AddSender registers a new funded key with the pool. It does not query
+// the client; the first Send from the address fetches its pending nonce.
+func (s *TxSender) AddSender(key *ecdsa.PrivateKey) common.Address {
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.senders[addr] = &txSenderAccount{key: key, addr: addr}
+	return addr
+}
+
+func (s *TxSender) account(from common.Address) (*txSenderAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc, ok := s.senders[from]
+	if !ok {
+		return nil, fmt.Errorf("TxSender: unknown sender %s", from)
+	}
+	return acc, nil
+}
+
+// pendingNonce returns the next usable nonce for addr as seen by the
+// client's transaction pool. It prefers eth_getTransactionCount with the
+// "pending" tag, and falls back to inspecting txpool_content for clients
+// that report a stale pending count.
+func (s *TxSender) pendingNonce(ctx context.Context, addr common.Address) (uint64, error) {
+	nonce, err := s.eth.PendingNonceAt(ctx, addr)
+	if err != nil {
+		return 0, err
+	}
+	var content struct {
+		Pending map[string]map[string]interface{} `json:"pending"`
+	}
+	if err := s.rpc.CallContext(ctx, &content, "txpool_content"); err != nil {
+		// txpool_content is not mandatory; the eth_getTransactionCount
+		// result is good enough if it is unavailable.
+		return nonce, nil
+	}
+	queued, ok := content.Pending[addr.Hex()]
+	if !ok || len(queued) == 0 {
+		return nonce, nil
+	}
+	highest := nonce
+	for nonceStr := range queued {
+		var n uint64
+		if _, err := fmt.Sscanf(nonceStr, "%d", &n); err == nil && n+1 > highest {
+			highest = n + 1
+		}
+	}
+	return highest, nil
+}
+
+// isNonceError reports whether err is the kind of rejection that means our
+// cached nonce has drifted from the client's view of the account, either
+// because another process used the account or because a reorg invalidated
+// transactions we thought were included.
+func isNonceError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	for _, sub := range []string{"nonce too low", "already known"} {
+		if strings.Contains(msg, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForReceipt polls for tx's receipt until it is mined or ctx expires.
+func (s *TxSender) waitForReceipt(ctx context.Context, tx common.Hash) error {
+	for {
+		_, err := s.eth.TransactionReceipt(ctx, tx)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// Send signs and sends tx from the given sender, retrying once with a
+// freshly-recovered nonce if the client reports the cached nonce is stale.
+// It blocks until the transaction is included, unlike
+// TestEnv.sendNextTransaction, which returns once the client accepts it.
+func (s *TxSender) Send(ctx context.Context, from common.Address, build func(nonce uint64) *types.Transaction) (*types.Transaction, error) {
+	acc, err := s.account(from)
+	if err != nil {
+		return nil, err
+	}
+	lock := s.locker.lock(from)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if acc.nonce == 0 {
+		n, err := s.pendingNonce(ctx, from)
+		if err != nil {
+			return nil, fmt.Errorf("TxSender: unable to recover nonce for %s: %v", from, err)
+		}
+		acc.nonce = n
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		tx := build(acc.nonce)
+		signed, err := types.SignTx(tx, types.NewLondonSigner(chainID), acc.key)
+		if err != nil {
+			return nil, fmt.Errorf("TxSender: could not sign tx: %v", err)
+		}
+		err = s.eth.SendTransaction(ctx, signed)
+		if err == nil {
+			acc.nonce++
+			if err := s.waitForReceipt(ctx, signed.Hash()); err != nil {
+				return nil, fmt.Errorf("TxSender: tx %s sent but never mined for %s: %v", signed.Hash(), from, err)
+			}
+			return signed, nil
+		}
+		if !isNonceError(err) || attempt == 1 {
+			return nil, fmt.Errorf("TxSender: send failed for %s: %v", from, err)
+		}
+		// Our cached nonce has drifted from the client's mempool state
+		// (e.g. another goroutine used this account, or a reorg
+		// invalidated a previously-included tx). Re-derive it and retry
+		// once before giving up.
+		n, rerr := s.pendingNonce(ctx, from)
+		if rerr != nil {
+			return nil, fmt.Errorf("TxSender: send failed (%v), and nonce recovery also failed: %v", err, rerr)
+		}
+		acc.nonce = n
+	}
+	panic("unreachable")
+}
+
+// SendMany dispatches every entry in txs, one goroutine per distinct sender
+// address. Requests for the same address are grouped in their original
+// relative order and run through that goroutine sequentially, so they are
+// actually issued in order; requests for distinct addresses still proceed
+// in parallel. It returns the signed transactions and the first error
+// encountered, if any.
+func (s *TxSender) SendMany(ctx context.Context, txs []SendRequest) ([]*types.Transaction, error) {
+	results := make([]*types.Transaction, len(txs))
+	errs := make([]error, len(txs))
+
+	var order []common.Address
+	groups := make(map[common.Address][]int)
+	for i, req := range txs {
+		if _, ok := groups[req.From]; !ok {
+			order = append(order, req.From)
+		}
+		groups[req.From] = append(groups[req.From], i)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(order))
+	for _, addr := range order {
+		idxs := groups[addr]
+		go func() {
+			defer wg.Done()
+			for _, i := range idxs {
+				tx, err := s.Send(ctx, txs[i].From, txs[i].Build)
+				results[i] = tx
+				errs[i] = err
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// SendRequest describes a single transaction to be dispatched by
+// TxSender.SendMany: the funded account to sign from, and a builder that
+// receives the nonce the TxSender has allocated for it.
+type SendRequest struct {
+	From  common.Address
+	Build func(nonce uint64) *types.Transaction
+}
+
+// TxSender returns a TxSender seeded with the given funded keys, backed by
+// this TestEnv's RPC connection. Tests that need to fire many transactions
+// across multiple accounts in parallel (mempool stress, reorg scenarios)
+// should use this instead of the single-account sendNextTransaction.
+func (t *TestEnv) TxSender(keys ...*ecdsa.PrivateKey) *TxSender {
+	return NewTxSender(t, keys...)
+}
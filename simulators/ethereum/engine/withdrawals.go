@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// WithdrawalsState tracks the queue of withdrawals a test wants included in
+// upcoming payloads, and the withdrawals root of the most recently built
+// payload, mirroring the bookkeeping go-ethereum's clmock keeps for
+// API.AddWithdrawal.
+type WithdrawalsState struct {
+	// Withdrawals waiting to be assigned to the next payload(s).
+	pending []*types.Withdrawal
+
+	// nextIndex is the withdrawal index to assign to the next queued
+	// withdrawal, per EIP-4895 (a global, ever-increasing counter).
+	nextIndex uint64
+
+	// lastWithdrawalsRoot is the withdrawals root of the most recently
+	// produced payload, as reported by engine_getPayloadV2.
+	lastWithdrawalsRoot *common.Hash
+
+	// included accumulates every withdrawal that has actually landed on
+	// chain via engine_newPayloadV2, for balance verification.
+	included []*types.Withdrawal
+}
+
+// QueueWithdrawal schedules w to be picked up by the next call(s) to
+// ProduceWithdrawalsPayload, currently the only consumer of the queue --
+// there is no CLMocker/produceSingleBlock hook that drains it. The
+// withdrawal's Index is assigned deterministically (in FIFO order) at queue
+// time, matching go-ethereum's AddWithdrawal; callers should leave w.Index
+// unset.
+func (t *TestEnv) QueueWithdrawal(w *types.Withdrawal) {
+	w.Index = t.withdrawals.nextIndex
+	t.withdrawals.nextIndex++
+	t.withdrawals.pending = append(t.withdrawals.pending, w)
+	t.Logf("INFO (%s): Queued withdrawal: index=%d, validator=%d, address=%s, amount=%d", t.TestName, w.Index, w.Validator, w.Address, w.Amount)
+}
+
+// nextPayloadWithdrawals pops up to n queued withdrawals for assignment into
+// the PayloadAttributesV2 of the next payload. A negative n means no limit
+// (pop everything pending); n == 0 pops none, so a caller can deliberately
+// build a Shanghai payload with zero withdrawals. Called only from
+// ProduceWithdrawalsPayload; there is no CLMocker/produceSingleBlock hook
+// that calls this.
+func (t *TestEnv) nextPayloadWithdrawals(n int) []*types.Withdrawal {
+	if n < 0 || n > len(t.withdrawals.pending) {
+		n = len(t.withdrawals.pending)
+	}
+	w := t.withdrawals.pending[:n]
+	t.withdrawals.pending = t.withdrawals.pending[n:]
+	return w
+}
+
+// LastPayloadWithdrawalsRoot returns the withdrawals root reported by
+// engine_getPayloadV2 for the most recently built payload, or nil if no
+// Shanghai payload has been built yet in this test.
+func (t *TestEnv) LastPayloadWithdrawalsRoot() *common.Hash {
+	return t.withdrawals.lastWithdrawalsRoot
+}
+
+// VerifyWithdrawalBalances checks that, for every address in addrs, the
+// post-state balance increase over startBalances (zero for an address not
+// in it) matches the sum of amounts of the withdrawals to that address
+// included so far by ProduceWithdrawalsPayload. Withdrawal
+// amounts are denominated in Gwei per EIP-4895, so they are scaled to Wei
+// before comparison.
+func (t *TestEnv) VerifyWithdrawalBalances(addrs []common.Address, startBalances map[common.Address]*big.Int) error {
+	want := make(map[common.Address]*big.Int, len(addrs))
+	for _, addr := range addrs {
+		want[addr] = new(big.Int)
+	}
+	for _, w := range t.withdrawals.included {
+		if amt, ok := want[w.Address]; ok {
+			gweiToWei := new(big.Int).Mul(new(big.Int).SetUint64(w.Amount), big.NewInt(1e9))
+			amt.Add(amt, gweiToWei)
+		}
+	}
+	for _, addr := range addrs {
+		got, err := t.Eth.BalanceAt(t.Ctx(), addr, nil)
+		if err != nil {
+			return fmt.Errorf("unable to fetch balance of %s: %v", addr, err)
+		}
+		start, ok := startBalances[addr]
+		if !ok {
+			start = new(big.Int)
+		}
+		gotIncrease := new(big.Int).Sub(got, start)
+		if gotIncrease.Cmp(want[addr]) != 0 {
+			return fmt.Errorf("withdrawal balance mismatch for %s: want increase=%d, got increase=%d", addr, want[addr], gotIncrease)
+		}
+	}
+	return nil
+}
+
+// recordIncludedWithdrawals is called once a payload carrying withdrawals
+// has been accepted via engine_newPayloadV2, so VerifyWithdrawalBalances
+// can be checked against what actually landed on chain rather than just
+// what was queued.
+func (t *TestEnv) recordIncludedWithdrawals(root common.Hash, withdrawals []*types.Withdrawal) {
+	t.withdrawals.lastWithdrawalsRoot = &root
+	t.withdrawals.included = append(t.withdrawals.included, withdrawals...)
+}
+
+// ProduceWithdrawalsPayload builds, submits, and finalizes a single
+// Shanghai payload on top of headBlockHash, assigning up to maxWithdrawals
+// of the queued withdrawals to it via PayloadAttributesV2. Pass a negative
+// maxWithdrawals for no limit (include everything pending), or 0 to build a
+// payload with no withdrawals at all. This is the Shanghai/Capella
+// counterpart of CLMocker.produceSingleBlock for tests that don't otherwise
+// drive the CL mock: it is what actually consumes nextPayloadWithdrawals
+// and feeds recordIncludedWithdrawals, so queued withdrawals end up
+// reflected in VerifyWithdrawalBalances.
+func (t *TestEnv) ProduceWithdrawalsPayload(headBlockHash common.Hash, timestamp uint64, maxWithdrawals int) (common.Hash, error) {
+	withdrawals := t.nextPayloadWithdrawals(maxWithdrawals)
+	if withdrawals == nil {
+		// A nil slice would be sent as null, i.e. pre-Shanghai attributes.
+		withdrawals = []*types.Withdrawal{}
+	}
+
+	attributes := map[string]interface{}{
+		"timestamp":             hexutil.Uint64(timestamp),
+		"prevRandao":            common.Hash{},
+		"suggestedFeeRecipient": common.Address{},
+		"withdrawals":           withdrawals,
+	}
+	forkchoiceState := map[string]interface{}{
+		"headBlockHash":      headBlockHash,
+		"safeBlockHash":      headBlockHash,
+		"finalizedBlockHash": headBlockHash,
+	}
+	var fcuResp struct {
+		PayloadStatus struct {
+			Status string `json:"status"`
+		} `json:"payloadStatus"`
+		PayloadID *hexutil.Bytes `json:"payloadId"`
+	}
+	if err := t.CallContext(t.Ctx(), &fcuResp, "engine_forkchoiceUpdatedV2", forkchoiceState, attributes); err != nil {
+		return common.Hash{}, fmt.Errorf("engine_forkchoiceUpdatedV2 failed: %v", err)
+	}
+	if fcuResp.PayloadID == nil {
+		return common.Hash{}, fmt.Errorf("engine_forkchoiceUpdatedV2 did not return a payload id (status=%s)", fcuResp.PayloadStatus.Status)
+	}
+
+	var payloadResp struct {
+		ExecutionPayload map[string]interface{} `json:"executionPayload"`
+	}
+	if err := t.CallContext(t.Ctx(), &payloadResp, "engine_getPayloadV2", *fcuResp.PayloadID); err != nil {
+		return common.Hash{}, fmt.Errorf("engine_getPayloadV2 failed: %v", err)
+	}
+
+	var newPayloadResp struct {
+		Status string `json:"status"`
+	}
+	if err := t.CallContext(t.Ctx(), &newPayloadResp, "engine_newPayloadV2", payloadResp.ExecutionPayload); err != nil {
+		return common.Hash{}, fmt.Errorf("engine_newPayloadV2 failed: %v", err)
+	}
+	if newPayloadResp.Status != "VALID" {
+		return common.Hash{}, fmt.Errorf("engine_newPayloadV2 returned status=%s, want VALID", newPayloadResp.Status)
+	}
+
+	blockHashAny, ok := payloadResp.ExecutionPayload["blockHash"]
+	if !ok {
+		return common.Hash{}, fmt.Errorf("payload response missing blockHash")
+	}
+	blockHash := common.HexToHash(fmt.Sprintf("%v", blockHashAny))
+	withdrawalsRootAny, ok := payloadResp.ExecutionPayload["withdrawalsRoot"]
+	if !ok {
+		return common.Hash{}, fmt.Errorf("payload response missing withdrawalsRoot")
+	}
+	withdrawalsRoot := common.HexToHash(fmt.Sprintf("%v", withdrawalsRootAny))
+	t.recordIncludedWithdrawals(withdrawalsRoot, withdrawals)
+
+	newForkchoiceState := map[string]interface{}{
+		"headBlockHash":      blockHash,
+		"safeBlockHash":      blockHash,
+		"finalizedBlockHash": blockHash,
+	}
+	var finalizeResp struct {
+		PayloadStatus struct {
+			Status string `json:"status"`
+		} `json:"payloadStatus"`
+	}
+	if err := t.CallContext(t.Ctx(), &finalizeResp, "engine_forkchoiceUpdatedV2", newForkchoiceState, nil); err != nil {
+		return common.Hash{}, fmt.Errorf("engine_forkchoiceUpdatedV2 (finalize) failed: %v", err)
+	}
+	if finalizeResp.PayloadStatus.Status != "VALID" {
+		return common.Hash{}, fmt.Errorf("finalizing forkchoice update returned status=%s, want VALID", finalizeResp.PayloadStatus.Status)
+	}
+
+	t.Logf("INFO (%s): Produced withdrawals payload: hash=%s, withdrawals=%d, withdrawalsRoot=%s", t.TestName, blockHash, len(withdrawals), withdrawalsRoot)
+	return blockHash, nil
+}